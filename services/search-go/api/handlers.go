@@ -4,15 +4,16 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/amirhf/imageSearch/services/search-go/federation"
 	"github.com/amirhf/imageSearch/services/search-go/models"
 	"github.com/amirhf/imageSearch/services/search-go/storage"
 )
 
 type Handler struct {
-	store *storage.PostgresStore
+	store storage.Backend
 }
 
-func NewHandler(store *storage.PostgresStore) *Handler {
+func NewHandler(store storage.Backend) *Handler {
 	return &Handler{store: store}
 }
 
@@ -35,8 +36,18 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 		req.Scope = "all"
 	}
 
+	ctx := r.Context()
+	if r.Header.Get(federation.ShardHeader) != "" {
+		ctx = federation.WithShardOnly(ctx)
+	}
+
+	if wantsStream(r) {
+		h.searchStream(w, r.WithContext(ctx), req)
+		return
+	}
+
 	// Call Storage
-	results, err := h.store.Search(r.Context(), req)
+	results, err := h.store.Search(ctx, req)
 	if err != nil {
 		http.Error(w, "Internal server error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -47,3 +58,60 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// wantsStream reports whether the caller asked for the NDJSON streaming
+// response instead of a single buffered JSON body. CLIP-based UIs commonly
+// request k=200-1000 for client-side reranking; streaming each row out as
+// soon as it's scanned keeps TTFB low and avoids holding the full result
+// set (and its JSON encoding) in memory at once.
+func wantsStream(r *http.Request) bool {
+	return r.Header.Get("Accept") == "application/x-ndjson" || r.URL.Query().Get("stream") == "1"
+}
+
+// searchStream writes one JSON-encoded SearchResultItem per line, flushing
+// after each, using storage.Backend.SearchStream instead of buffering the
+// full result slice.
+func (h *Handler) searchStream(w http.ResponseWriter, r *http.Request, req models.SearchRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	itemCh, errCh := h.store.SearchStream(r.Context(), req)
+
+	// Peek the first result before writing anything: if the store fails
+	// before producing a single row (e.g. "user_id required for
+	// scope=mine"), itemCh closes with no value and errCh carries the
+	// error. Reporting that as a proper 500, like the non-streaming path
+	// does, requires not having committed to a 200 response yet.
+	first, ok := <-itemCh
+	if !ok {
+		if err := <-errCh; err != nil {
+			http.Error(w, "Internal server error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+
+	if err := enc.Encode(first); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	for item := range itemCh {
+		if err := enc.Encode(item); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+	if err := <-errCh; err != nil {
+		// Headers are already sent by this point, so the best we can do is
+		// stop writing; the client sees a truncated stream.
+		return
+	}
+}
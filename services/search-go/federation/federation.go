@@ -0,0 +1,266 @@
+// Package federation lets a search-go instance fan a query out to peer
+// instances and merge their results, so the search tier can be sharded
+// horizontally without relying on pgvector's own partitioning.
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirhf/imageSearch/services/search-go/models"
+	"github.com/amirhf/imageSearch/services/search-go/storage"
+)
+
+// ShardHeader is set on requests forwarded between peers so the receiving
+// instance knows to answer from its local shard only, instead of fanning
+// out again (guards against federation loops in misconfigured peer lists).
+const ShardHeader = "X-Search-Shard"
+
+// defaultRRFK mirrors storage.defaultRRFK; federation scores peers'
+// already-ranked lists the same way PostgresStore fuses vector/text ranks.
+const defaultRRFK = 60
+
+// defaultPeerTimeout bounds a single peer call so one slow shard can't
+// stall the whole fan-out; the overall fan-out is additionally bounded by
+// the context deadline the caller passes in.
+const defaultPeerTimeout = 2 * time.Second
+
+type ctxKey int
+
+const shardOnlyKey ctxKey = 0
+
+// WithShardOnly marks ctx so FederatedStore.Search answers from the local
+// backend only, skipping peer fan-out. api.Handler sets this when it sees
+// ShardHeader on an incoming request.
+func WithShardOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, shardOnlyKey, true)
+}
+
+func isShardOnly(ctx context.Context) bool {
+	v, _ := ctx.Value(shardOnlyKey).(bool)
+	return v
+}
+
+// FederatedStore implements storage.Backend by combining a local backend
+// with N remote search-go peers, configured via SEARCH_PEERS.
+type FederatedStore struct {
+	local  storage.Backend
+	peers  []string
+	client *http.Client
+}
+
+var _ storage.Backend = (*FederatedStore)(nil)
+
+// NewFederatedStore builds a FederatedStore that searches local alongside
+// the given peers (e.g. "http://host2:8080"). Entries with no scheme (the
+// documented SEARCH_PEERS format is a bare "host:port" list) are normalized
+// to http:// so a missing scheme doesn't turn into a silent per-peer
+// request failure.
+func NewFederatedStore(local storage.Backend, peers []string) *FederatedStore {
+	normalized := make([]string, len(peers))
+	for i, peer := range peers {
+		normalized[i] = normalizePeer(peer)
+	}
+	return &FederatedStore{
+		local:  local,
+		peers:  normalized,
+		client: &http.Client{Timeout: defaultPeerTimeout},
+	}
+}
+
+// normalizePeer prepends http:// to a peer address that has no scheme.
+func normalizePeer(peer string) string {
+	if strings.Contains(peer, "://") {
+		return peer
+	}
+	return "http://" + peer
+}
+
+func (f *FederatedStore) Close() error {
+	return f.local.Close()
+}
+
+// Index only ever targets the local shard; there is no cross-shard write
+// path today.
+func (f *FederatedStore) Index(ctx context.Context, doc models.ImageDocument) error {
+	return f.local.Index(ctx, doc)
+}
+
+// Search fans req out to the local backend and every peer concurrently,
+// each peer call bounded by defaultPeerTimeout, all bounded by ctx's deadline, then
+// merges the ranked lists with Reciprocal Rank Fusion over each source's
+// local rank.
+func (f *FederatedStore) Search(ctx context.Context, req models.SearchRequest) ([]models.SearchResultItem, error) {
+	if isShardOnly(ctx) || len(f.peers) == 0 {
+		return f.local.Search(ctx, req)
+	}
+
+	lists := make([]rankedList, 0, len(f.peers)+1)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		items, err := f.local.Search(ctx, req)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		lists = append(lists, rankedList{source: "local", items: items})
+		mu.Unlock()
+	}()
+
+	for _, peer := range f.peers {
+		peer := peer
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			items, err := f.searchPeer(ctx, peer, req)
+			if err != nil {
+				log.Printf("federation: peer %s: %v", peer, err)
+				return
+			}
+			mu.Lock()
+			lists = append(lists, rankedList{source: peer, items: items})
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(lists) == 0 {
+		return nil, fmt.Errorf("federation: no shard returned results")
+	}
+
+	k := req.K
+	if k <= 0 {
+		k = 10
+	}
+	return mergeRankedLists(lists, k), nil
+}
+
+// rankedList is one shard's (or the local backend's) already-ranked result
+// set, as fed into mergeRankedLists.
+type rankedList struct {
+	source string
+	items  []models.SearchResultItem
+}
+
+// fused accumulates a single item's Reciprocal Rank Fusion score across
+// every rankedList it appears in.
+type fused struct {
+	item  models.SearchResultItem
+	score float32
+}
+
+// mergeRankedLists fuses multiple shards' ranked result lists into one,
+// keyed by item ID, and returns the top k. Merging by ID before scoring
+// matters because the same image can come back from more than one shard
+// (replicated data, or a peer double-counting a local item); without it an
+// ID would occupy multiple result slots instead of having its ranks fused,
+// exactly the bug PostgresStore.searchRRF avoids by keying its merge map on
+// ID.
+func mergeRankedLists(lists []rankedList, k int) []models.SearchResultItem {
+	merged := make(map[string]*fused)
+	for _, list := range lists {
+		for rank, item := range list.items {
+			rankScore := 1.0 / float32(defaultRRFK+rank+1)
+			if existing, ok := merged[item.ID]; ok {
+				existing.score += rankScore
+				continue
+			}
+			merged[item.ID] = &fused{item: item, score: rankScore}
+		}
+	}
+
+	candidates := make([]*fused, 0, len(merged))
+	for _, c := range merged {
+		candidates = append(candidates, c)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		// Ranks tied across shards (e.g. both shards' top hit): fall back
+		// to comparing the shards' own reported scores.
+		return candidates[i].item.Score > candidates[j].item.Score
+	})
+
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+
+	results := make([]models.SearchResultItem, len(candidates))
+	for i, c := range candidates {
+		results[i] = c.item
+	}
+	return results
+}
+
+// SearchStream runs Search and forwards its already-fused results one at a
+// time. Fusing ranks from every shard requires every shard to have
+// responded first, so there's no earlier point at which results could
+// start streaming; this exists so FederatedStore satisfies Backend.
+func (f *FederatedStore) SearchStream(ctx context.Context, req models.SearchRequest) (<-chan models.SearchResultItem, <-chan error) {
+	itemCh := make(chan models.SearchResultItem)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(itemCh)
+		defer close(errCh)
+
+		items, err := f.Search(ctx, req)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		for _, item := range items {
+			select {
+			case itemCh <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return itemCh, errCh
+}
+
+func (f *FederatedStore) searchPeer(ctx context.Context, peer string, req models.SearchRequest) ([]models.SearchResultItem, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+"/search", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(ShardHeader, "1")
+
+	resp, err := f.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("peer %s: %w", peer, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s: status %d", peer, resp.StatusCode)
+	}
+
+	var out models.SearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("peer %s: decode response: %w", peer, err)
+	}
+	return out.Results, nil
+}
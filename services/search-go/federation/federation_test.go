@@ -0,0 +1,72 @@
+package federation
+
+import (
+	"testing"
+
+	"github.com/amirhf/imageSearch/services/search-go/models"
+)
+
+func TestMergeRankedLists_DedupesSameIDAcrossShards(t *testing.T) {
+	// "img-1" is returned by both shards: without merging by ID it would
+	// occupy two of the k result slots instead of having its ranks fused
+	// into one entry.
+	lists := []rankedList{
+		{source: "local", items: []models.SearchResultItem{
+			{ID: "img-1", Score: 0.9},
+			{ID: "img-2", Score: 0.5},
+		}},
+		{source: "peer1", items: []models.SearchResultItem{
+			{ID: "img-1", Score: 0.8},
+			{ID: "img-3", Score: 0.4},
+		}},
+	}
+
+	results := mergeRankedLists(lists, 10)
+
+	if len(results) != 3 {
+		t.Fatalf("len(results) = %d, want 3 (img-1, img-2, img-3 each once)", len(results))
+	}
+
+	seen := map[string]int{}
+	for _, r := range results {
+		seen[r.ID]++
+	}
+	for id, count := range seen {
+		if count != 1 {
+			t.Errorf("id %s appeared %d times, want 1", id, count)
+		}
+	}
+}
+
+func TestMergeRankedLists_DuplicateIDRanksHigherThanSingleShardHit(t *testing.T) {
+	// img-1 appears in both lists at rank 0, so its fused RRF score is
+	// roughly double a same-rank single-shard item's score and should sort
+	// first.
+	lists := []rankedList{
+		{source: "local", items: []models.SearchResultItem{{ID: "img-1"}}},
+		{source: "peer1", items: []models.SearchResultItem{{ID: "img-1"}, {ID: "img-2"}}},
+	}
+
+	results := mergeRankedLists(lists, 10)
+
+	if len(results) != 2 {
+		t.Fatalf("len(results) = %d, want 2", len(results))
+	}
+	if results[0].ID != "img-1" {
+		t.Errorf("results[0].ID = %q, want %q", results[0].ID, "img-1")
+	}
+}
+
+func TestMergeRankedLists_TruncatesToK(t *testing.T) {
+	lists := []rankedList{
+		{source: "local", items: []models.SearchResultItem{
+			{ID: "img-1"}, {ID: "img-2"}, {ID: "img-3"},
+		}},
+	}
+
+	results := mergeRankedLists(lists, 2)
+
+	if len(results) != 2 {
+		t.Fatalf("len(results) = %d, want 2", len(results))
+	}
+}
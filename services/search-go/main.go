@@ -7,10 +7,12 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/amirhf/imageSearch/services/search-go/api"
+	"github.com/amirhf/imageSearch/services/search-go/federation"
 	"github.com/amirhf/imageSearch/services/search-go/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -27,20 +29,40 @@ func main() {
 	if port == "" {
 		port = "8080"
 	}
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL is required")
-	}
-
 	// Initialize Storage
-	// Fix for SQLAlchemy scheme
-	if len(dbURL) > 18 && dbURL[:19] == "postgresql+psycopg:" {
-		dbURL = "postgres:" + dbURL[19:]
+	backend := os.Getenv("SEARCH_BACKEND")
+	if backend == "" {
+		backend = "postgres"
 	}
 
-	store, err := storage.NewPostgresStore(dbURL)
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+	var store storage.Backend
+	switch backend {
+	case "bleve":
+		indexPath := os.Getenv("BLEVE_INDEX_PATH")
+		if indexPath == "" {
+			indexPath = "./data/bleve"
+		}
+		s, err := storage.NewBleveStore(indexPath)
+		if err != nil {
+			log.Fatalf("Failed to open bleve index: %v", err)
+		}
+		store = s
+	case "postgres":
+		dbURL := os.Getenv("DATABASE_URL")
+		if dbURL == "" {
+			log.Fatal("DATABASE_URL is required")
+		}
+		// Fix for SQLAlchemy scheme
+		if len(dbURL) > 18 && dbURL[:19] == "postgresql+psycopg:" {
+			dbURL = "postgres:" + dbURL[19:]
+		}
+		s, err := storage.NewPostgresStore(dbURL)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		store = s
+	default:
+		log.Fatalf("Unknown SEARCH_BACKEND %q (expected postgres or bleve)", backend)
 	}
 	defer store.Close()
 
@@ -57,6 +79,13 @@ func main() {
 	// Routes
 	handler := api.NewHandler(store)
 	r.Post("/search", handler.Search)
+
+	if peersEnv := os.Getenv("SEARCH_PEERS"); peersEnv != "" {
+		peers := strings.Split(peersEnv, ",")
+		fedHandler := api.NewHandler(federation.NewFederatedStore(store, peers))
+		r.Post("/search/federated", fedHandler.Search)
+	}
+
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
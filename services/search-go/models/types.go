@@ -8,6 +8,26 @@ type SearchRequest struct {
 	Scope       string    `json:"scope"`
 	TextQuery   string    `json:"text_query,omitempty"`
 	HybridBoost float32   `json:"hybrid_boost,omitempty"`
+	// FusionMode selects how vector and text signals are combined.
+	// "" (default) uses the linear hybrid_boost-weighted sum; "rrf" uses
+	// Reciprocal Rank Fusion instead, see PostgresStore.searchRRF.
+	FusionMode string `json:"fusion_mode,omitempty"`
+	// RRFK is the RRF rank-damping constant (k in 1/(k+rank)). Defaults to
+	// 60 when FusionMode is "rrf" and RRFK is unset.
+	RRFK int `json:"rrf_k,omitempty"`
+	// Highlight requests ts_headline-derived match metadata on each result
+	// (see SearchResultItem.Highlights). Off by default since it's an
+	// extra per-row computation callers may not need.
+	Highlight bool `json:"highlight,omitempty"`
+}
+
+// Highlight describes how a query matched a single field, modeled on the
+// match-level highlighting typical search APIs return.
+type Highlight struct {
+	Value            string   `json:"value"`
+	MatchLevel       string   `json:"matchLevel"` // "none" | "partial" | "full"
+	MatchedWords     []string `json:"matchedWords"`
+	FullyHighlighted bool     `json:"fullyHighlighted"`
 }
 
 // SearchResultItem represents a single search result
@@ -22,9 +42,26 @@ type SearchResultItem struct {
 	OwnerUserID       string  `json:"owner_user_id,omitempty"`
 	Visibility        string  `json:"visibility"`
 	CreatedAt         string  `json:"created_at"`
+	// Highlights is only populated when SearchRequest.Highlight is set,
+	// keyed by field name (currently only "caption").
+	Highlights map[string]Highlight `json:"highlights,omitempty"`
 }
 
 // SearchResponse represents the search response body
 type SearchResponse struct {
 	Results []SearchResultItem `json:"results"`
 }
+
+// ImageDocument is the unit of work a storage.Backend indexes. It mirrors
+// the columns PostgresStore.Search selects from the images table so that
+// every backend can be populated from the same ingestion path.
+type ImageDocument struct {
+	ID                string    `json:"id"`
+	Vector            []float32 `json:"vector"`
+	Caption           string    `json:"caption"`
+	CaptionConfidence float32   `json:"caption_confidence"`
+	CaptionOrigin     string    `json:"caption_origin"`
+	OwnerUserID       string    `json:"owner_user_id,omitempty"`
+	Visibility        string    `json:"visibility"`
+	CreatedAt         string    `json:"created_at"`
+}
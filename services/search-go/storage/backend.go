@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/amirhf/imageSearch/services/search-go/models"
+)
+
+// Backend is implemented by every search storage engine the service can run
+// against. PostgresStore (pgvector + full-text search) and BleveStore
+// (embedded, on-disk) are the two implementations today; main.go selects one
+// at startup via SEARCH_BACKEND.
+type Backend interface {
+	// Search runs a hybrid vector/text query and returns the top-K results.
+	Search(ctx context.Context, req models.SearchRequest) ([]models.SearchResultItem, error)
+	// SearchStream is Search's incremental counterpart: results are sent on
+	// the returned channel as soon as they're available rather than
+	// collected into a slice first, so api.Handler can start writing a
+	// response before the full top-K is known. The result channel is
+	// closed when the search completes; the error channel carries at most
+	// one error and is closed afterwards.
+	SearchStream(ctx context.Context, req models.SearchRequest) (<-chan models.SearchResultItem, <-chan error)
+	// Index upserts a single image document into the backend.
+	Index(ctx context.Context, doc models.ImageDocument) error
+	// Close releases any resources held by the backend.
+	Close() error
+}
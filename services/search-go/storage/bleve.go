@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/amirhf/imageSearch/services/search-go/models"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// BleveStore is an embedded, on-disk Backend implementation. It exists so
+// small deployments can run the search service without standing up
+// Postgres/pgvector.
+//
+// Bleve's native vector KNN index (bleve.NewVectorFieldMapping,
+// SearchRequest.AddKNN) only builds under `-tags vectors`, and that tag
+// pulls in github.com/blevesearch/go-faiss, which requires linking against
+// the native libfaiss C library via cgo. That's a heavier, less portable
+// dependency than the embedded mode is meant to avoid, so instead vectors
+// are stored as an opaque JSON blob and reranked with plain-Go cosine
+// similarity over the text-matched candidate window. Fine for the small
+// corpora this backend targets; a true ANN index is future work if a
+// deployment outgrows brute-force reranking.
+type BleveStore struct {
+	index bleve.Index
+}
+
+var _ Backend = (*BleveStore)(nil)
+
+// NewBleveStore opens (or creates, if absent) a Bleve index at path.
+func NewBleveStore(path string) (*BleveStore, error) {
+	index, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		index, err = bleve.New(path, buildIndexMapping())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open bleve index: %w", err)
+	}
+	return &BleveStore{index: index}, nil
+}
+
+func buildIndexMapping() *mapping.IndexMappingImpl {
+	captionField := bleve.NewTextFieldMapping()
+	captionField.Analyzer = "en"
+
+	// visibility/owner_user_id are matched exactly (see buildVisibilityQuery),
+	// never analyzed as prose.
+	keywordField := bleve.NewTextFieldMapping()
+	keywordField.Analyzer = "keyword"
+	keywordField.IncludeInAll = false
+
+	vectorField := bleve.NewTextFieldMapping()
+	vectorField.Index = false
+	vectorField.Store = true
+	vectorField.IncludeInAll = false
+
+	doc := bleve.NewDocumentMapping()
+	doc.AddFieldMappingsAt("caption", captionField)
+	doc.AddFieldMappingsAt("visibility", keywordField)
+	doc.AddFieldMappingsAt("owner_user_id", keywordField)
+	doc.AddFieldMappingsAt("vector_json", vectorField)
+
+	im := bleve.NewIndexMapping()
+	im.DefaultMapping = doc
+	return im
+}
+
+// bleveDoc is the shape persisted in the index; it carries enough of
+// models.ImageDocument to reconstruct a SearchResultItem without a second
+// lookup. The embedding is JSON-encoded rather than indexed as a numeric
+// array field, since it's only ever read back for the cosine rerank in
+// Search, never queried on directly.
+type bleveDoc struct {
+	VectorJSON        string  `json:"vector_json"`
+	Caption           string  `json:"caption"`
+	CaptionConfidence float32 `json:"caption_confidence"`
+	CaptionOrigin     string  `json:"caption_origin"`
+	OwnerUserID       string  `json:"owner_user_id"`
+	Visibility        string  `json:"visibility"`
+	CreatedAt         string  `json:"created_at"`
+}
+
+func (s *BleveStore) Index(ctx context.Context, doc models.ImageDocument) error {
+	vecJSON, err := json.Marshal(doc.Vector)
+	if err != nil {
+		return fmt.Errorf("marshal vector: %w", err)
+	}
+	return s.index.Index(doc.ID, bleveDoc{
+		VectorJSON:        string(vecJSON),
+		Caption:           doc.Caption,
+		CaptionConfidence: doc.CaptionConfidence,
+		CaptionOrigin:     doc.CaptionOrigin,
+		OwnerUserID:       doc.OwnerUserID,
+		Visibility:        doc.Visibility,
+		CreatedAt:         doc.CreatedAt,
+	})
+}
+
+// candidateMultiplier controls how many text-matched candidates are pulled
+// before the cosine rerank and k-truncation, the same role PostgresStore's
+// searchRRF N=max(k*5, 100) window plays.
+const candidateMultiplier = 10
+const minCandidates = 200
+
+func (s *BleveStore) Search(ctx context.Context, req models.SearchRequest) ([]models.SearchResultItem, error) {
+	k := req.K
+	if k <= 0 {
+		k = 10
+	}
+	hybridBoost := req.HybridBoost
+	if hybridBoost == 0 {
+		hybridBoost = 0.3
+	}
+	vecWeight := 1.0 - hybridBoost
+
+	var textQuery query.Query
+	if req.TextQuery != "" {
+		mq := bleve.NewMatchQuery(req.TextQuery)
+		mq.SetField("caption")
+		textQuery = mq
+	} else {
+		textQuery = bleve.NewMatchAllQuery()
+	}
+
+	visibilityQuery, err := buildVisibilityQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	combined := bleve.NewConjunctionQuery(textQuery, visibilityQuery)
+
+	// With no text query, every doc matches equally (MatchAllQuery scores
+	// them all 1.0) and there's nothing but doc order to decide which
+	// candidateMultiplier*k hits Bleve would hand back — so instead of a
+	// narrow window that can silently drop the true nearest neighbors once
+	// the index grows past it, rerank the whole index. PostgresStore.Search
+	// does the equivalent full-table ORDER BY for the same empty-TextQuery
+	// case, and Bleve needs to match that rather than being an approximate,
+	// corpus-size-dependent answer.
+	candidateLimit := k * candidateMultiplier
+	if candidateLimit < minCandidates {
+		candidateLimit = minCandidates
+	}
+	if req.TextQuery == "" {
+		docCount, err := s.index.DocCount()
+		if err != nil {
+			return nil, fmt.Errorf("bleve doc count: %w", err)
+		}
+		if docCount > uint64(candidateLimit) {
+			candidateLimit = int(docCount)
+		}
+	}
+
+	searchReq := bleve.NewSearchRequestOptions(combined, candidateLimit, 0, false)
+	searchReq.Fields = []string{"*"}
+
+	result, err := s.index.SearchInContext(ctx, searchReq)
+	if err != nil {
+		return nil, fmt.Errorf("bleve search: %w", err)
+	}
+
+	items := make([]models.SearchResultItem, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		var vec []float32
+		if vecJSON := fieldString(hit.Fields, "vector_json"); vecJSON != "" {
+			if err := json.Unmarshal([]byte(vecJSON), &vec); err != nil {
+				return nil, fmt.Errorf("unmarshal vector for %s: %w", hit.ID, err)
+			}
+		}
+		vecScore := cosineSimilarity(req.Vector, vec)
+		textScore := float32(hit.Score)
+
+		item := models.SearchResultItem{
+			ID:                hit.ID,
+			VecScore:          vecScore,
+			TextScore:         textScore,
+			Score:             vecScore*vecWeight + textScore*hybridBoost,
+			Caption:           fieldString(hit.Fields, "caption"),
+			CaptionConfidence: fieldFloat32(hit.Fields, "caption_confidence"),
+			CaptionOrigin:     fieldString(hit.Fields, "caption_origin"),
+			OwnerUserID:       fieldString(hit.Fields, "owner_user_id"),
+			Visibility:        fieldString(hit.Fields, "visibility"),
+			CreatedAt:         fieldString(hit.Fields, "created_at"),
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Score > items[j].Score })
+	if len(items) > k {
+		items = items[:k]
+	}
+	return items, nil
+}
+
+// buildVisibilityQuery mirrors storage.buildVisibilityConditions: it scopes
+// results to what req.UserID is allowed to see, pushed into the Bleve query
+// itself (not applied after the fact) so visibility never eats into the
+// candidate window before truncation.
+func buildVisibilityQuery(req models.SearchRequest) (query.Query, error) {
+	switch req.Scope {
+	case "mine":
+		if req.UserID == "" {
+			return nil, fmt.Errorf("user_id required for scope=mine")
+		}
+		ownerQuery := bleve.NewTermQuery(req.UserID)
+		ownerQuery.SetField("owner_user_id")
+		return ownerQuery, nil
+	case "public":
+		publicQuery := bleve.NewTermQuery("public")
+		publicQuery.SetField("visibility")
+		return publicQuery, nil
+	default: // all
+		publicQuery := bleve.NewTermQuery("public")
+		publicQuery.SetField("visibility")
+		if req.UserID == "" {
+			return publicQuery, nil
+		}
+		ownerQuery := bleve.NewTermQuery(req.UserID)
+		ownerQuery.SetField("owner_user_id")
+		return bleve.NewDisjunctionQuery(publicQuery, ownerQuery), nil
+	}
+}
+
+// cosineSimilarity returns 0 for mismatched or empty vectors rather than
+// erroring, since a document with a missing/corrupt embedding should just
+// rank last on the vector signal, not fail the whole search.
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) == 0 || len(b) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
+
+// SearchStream runs Search and forwards its results one at a time. Bleve
+// returns its hits as a single ranked batch, so there's nothing to stream
+// incrementally here; this exists so BleveStore satisfies Backend and
+// callers get the same streaming shape regardless of which backend is
+// selected.
+func (s *BleveStore) SearchStream(ctx context.Context, req models.SearchRequest) (<-chan models.SearchResultItem, <-chan error) {
+	itemCh := make(chan models.SearchResultItem)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(itemCh)
+		defer close(errCh)
+
+		items, err := s.Search(ctx, req)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		for _, item := range items {
+			select {
+			case itemCh <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return itemCh, errCh
+}
+
+func (s *BleveStore) Close() error {
+	return s.index.Close()
+}
+
+func fieldString(fields map[string]interface{}, key string) string {
+	if v, ok := fields[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func fieldFloat32(fields map[string]interface{}, key string) float32 {
+	if v, ok := fields[key].(float64); ok {
+		return float32(v)
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package storage
+
+import "testing"
+
+func TestBuildHighlight_FullMatch(t *testing.T) {
+	h := buildHighlight("a <mark>red</mark> <mark>bicycle</mark> leaning on a wall", 2, 2)
+
+	if h.MatchLevel != "full" {
+		t.Errorf("MatchLevel = %q, want %q", h.MatchLevel, "full")
+	}
+	if !h.FullyHighlighted {
+		t.Error("FullyHighlighted = false, want true")
+	}
+	if len(h.MatchedWords) != 2 || h.MatchedWords[0] != "red" || h.MatchedWords[1] != "bicycle" {
+		t.Errorf("MatchedWords = %v, want [red bicycle]", h.MatchedWords)
+	}
+	if h.Value == "" {
+		t.Error("Value is empty, want the raw headline")
+	}
+}
+
+func TestBuildHighlight_PartialMatch(t *testing.T) {
+	h := buildHighlight("a <mark>red</mark> bicycle leaning on a wall", 2, 1)
+
+	if h.MatchLevel != "partial" {
+		t.Errorf("MatchLevel = %q, want %q", h.MatchLevel, "partial")
+	}
+	if h.FullyHighlighted {
+		t.Error("FullyHighlighted = true, want false")
+	}
+}
+
+func TestBuildHighlight_NoMatch(t *testing.T) {
+	h := buildHighlight("a bicycle leaning on a wall", 1, 0)
+
+	if h.MatchLevel != "none" {
+		t.Errorf("MatchLevel = %q, want %q", h.MatchLevel, "none")
+	}
+	if h.FullyHighlighted {
+		t.Error("FullyHighlighted = true, want false")
+	}
+	if len(h.MatchedWords) != 0 {
+		t.Errorf("MatchedWords = %v, want none", h.MatchedWords)
+	}
+}
+
+func TestBuildHighlight_QueryIsOnlyStopwords(t *testing.T) {
+	// to_tsvector also drops stopwords, so a query of only stopwords comes
+	// back with queryLexemes=0; that can never be reported as "full" even
+	// though the headline has marks from an unrelated query term.
+	h := buildHighlight("a <mark>red</mark> bicycle", 0, 0)
+
+	if h.MatchLevel != "none" {
+		t.Errorf("MatchLevel = %q, want %q", h.MatchLevel, "none")
+	}
+}
+
+func TestBuildHighlight_MatchedWordsDeduped(t *testing.T) {
+	h := buildHighlight("<mark>red</mark> <mark>red</mark> bicycle", 1, 1)
+
+	if len(h.MatchedWords) != 1 || h.MatchedWords[0] != "red" {
+		t.Errorf("MatchedWords = %v, want [red]", h.MatchedWords)
+	}
+}
+
+// TestBuildHighlight_StemmedMatchCountsAsFull is the regression test for the
+// bug this signature change fixes: ts_headline marks "bicycle" for a query
+// of "bicycles" (both stem to the same lexeme), so a literal string
+// comparison between the marked word and the raw query token would wrongly
+// report this as anything but "full". queryLexemes/matchedLexemes are
+// computed in SQL from stemmed tsvectors, so the mismatched surface forms
+// never enter into the match-level decision.
+func TestBuildHighlight_StemmedMatchCountsAsFull(t *testing.T) {
+	h := buildHighlight("a red <mark>bicycle</mark>", 1, 1)
+
+	if h.MatchLevel != "full" {
+		t.Errorf("MatchLevel = %q, want %q", h.MatchLevel, "full")
+	}
+	if len(h.MatchedWords) != 1 || h.MatchedWords[0] != "bicycle" {
+		t.Errorf("MatchedWords = %v, want [bicycle]", h.MatchedWords)
+	}
+}
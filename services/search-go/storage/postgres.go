@@ -3,21 +3,40 @@ package storage
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/amirhf/imageSearch/services/search-go/models"
+	"github.com/amirhf/imageSearch/services/search-go/storage/querybuilder"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pgvector/pgvector-go"
+	pgxvector "github.com/pgvector/pgvector-go/pgx"
 )
 
+// defaultRRFK is the rank-damping constant used by searchRRF when the
+// caller doesn't set SearchRequest.RRFK.
+const defaultRRFK = 60
+
 type PostgresStore struct {
 	pool *pgxpool.Pool
 }
 
+var _ Backend = (*PostgresStore)(nil)
+
 func NewPostgresStore(dbURL string) (*PostgresStore, error) {
 	config, err := pgxpool.ParseConfig(dbURL)
 	if err != nil {
 		return nil, err
 	}
+	// WHERE clauses are now built from a fixed set of templates
+	// (querybuilder) rather than interpolated literals, so each query
+	// shape has stable SQL text: let pgx prepare and cache a statement per
+	// shape instead of planning from scratch on every request.
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		return pgxvector.RegisterTypes(ctx, conn)
+	}
 	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		return nil, err
@@ -25,17 +44,84 @@ func NewPostgresStore(dbURL string) (*PostgresStore, error) {
 	return &PostgresStore{pool: pool}, nil
 }
 
-func (s *PostgresStore) Close() {
+func (s *PostgresStore) Close() error {
 	s.pool.Close()
+	return nil
+}
+
+// Index upserts a single image document, keyed by ID.
+func (s *PostgresStore) Index(ctx context.Context, doc models.ImageDocument) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO images (id, embed_vector, caption, caption_confidence, caption_origin, owner_user_id, visibility, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, now())
+		ON CONFLICT (id) DO UPDATE SET
+			embed_vector = EXCLUDED.embed_vector,
+			caption = EXCLUDED.caption,
+			caption_confidence = EXCLUDED.caption_confidence,
+			caption_origin = EXCLUDED.caption_origin,
+			owner_user_id = EXCLUDED.owner_user_id,
+			visibility = EXCLUDED.visibility
+	`, doc.ID, pgvector.NewVector(doc.Vector), doc.Caption, doc.CaptionConfidence, doc.CaptionOrigin, doc.OwnerUserID, doc.Visibility)
+	return err
+}
+
+// buildVisibilityConditions returns the WHERE clause scoping results to
+// what req.UserID is allowed to see, and the bound arguments it references.
+// startAt is the number of positional args the caller's base query already
+// uses, so placeholders here continue the same sequence (e.g. startAt=5
+// emits $6, $7, ...). Shared by every query shape below.
+func buildVisibilityConditions(req models.SearchRequest, startAt int) (string, []any, error) {
+	qb := querybuilder.New(startAt)
+	switch req.Scope {
+	case "mine":
+		if req.UserID == "" {
+			return "", nil, fmt.Errorf("user_id required for scope=mine")
+		}
+		qb.And("owner_user_id = %s", req.UserID)
+	case "public":
+		qb.Raw("visibility = 'public'")
+	default: // all
+		if req.UserID != "" {
+			qb.And("(visibility = 'public' OR owner_user_id = %s)", req.UserID)
+		} else {
+			qb.Raw("visibility = 'public'")
+		}
+	}
+	where, args := qb.Build()
+	return where, args, nil
 }
 
 func (s *PostgresStore) Search(ctx context.Context, req models.SearchRequest) ([]models.SearchResultItem, error) {
-	// Build query
-	// Note: We use pgvector's <=> operator for cosine distance (if vectors are normalized) or L2 distance.
-	// For OpenCLIP (normalized), <=> is equivalent to 1 - cosine_similarity.
-	// We want to maximize similarity, so we sort by distance ASC.
-	// Hybrid score = (vec_weight * vec_score) + (text_weight * text_score)
+	if req.FusionMode == "rrf" {
+		return s.searchRRF(ctx, req)
+	}
 
+	rows, vecWeight, hybridBoost, err := s.queryLinear(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.SearchResultItem
+	for rows.Next() {
+		item, err := scanLinearRow(rows, req, vecWeight, hybridBoost)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, item)
+	}
+	return results, rows.Err()
+}
+
+// queryLinear runs the single-pass hybrid query (linear vec/text weighting)
+// and hands back the open rows for the caller to scan, along with the
+// weights scanLinearRow needs to compute SearchResultItem.Score.
+//
+// Note: We use pgvector's <=> operator for cosine distance (if vectors are
+// normalized) or L2 distance. For OpenCLIP (normalized), <=> is equivalent
+// to 1 - cosine_similarity. We want to maximize similarity, so we sort by
+// distance ASC. Hybrid score = (vec_weight * vec_score) + (text_weight * text_score)
+func (s *PostgresStore) queryLinear(ctx context.Context, req models.SearchRequest) (pgx.Rows, float32, float32, error) {
 	// Default weights if not provided
 	hybridBoost := req.HybridBoost
 	if hybridBoost == 0 {
@@ -44,8 +130,15 @@ func (s *PostgresStore) Search(ctx context.Context, req models.SearchRequest) ([
 	vecWeight := 1.0 - hybridBoost
 
 	// Simplified Hybrid Query (Single Pass)
+	highlightCol := ""
+	if req.Highlight {
+		highlightCol = `,
+			ts_headline('english', caption, websearch_to_tsquery('english', $2),
+				'StartSel=<mark>,StopSel=</mark>,MaxWords=35,MinWords=15') as headline,
+			` + lexemeMatchColumns("$2")
+	}
 	simpleQuery := `
-		SELECT 
+		SELECT
 			id,
 			(1 - (embed_vector <=> $1)) as vec_score,
 			ts_rank_cd(search_vector, websearch_to_tsquery('english', $2)) as text_score,
@@ -54,76 +147,414 @@ func (s *PostgresStore) Search(ctx context.Context, req models.SearchRequest) ([
 			caption_origin,
 			owner_user_id::text,
 			visibility,
-			created_at::text
+			created_at::text` + highlightCol + `
 		FROM images
 		WHERE %s
 		ORDER BY (
-			(1 - (embed_vector <=> $1)) * $3 + 
+			(1 - (embed_vector <=> $1)) * $3 +
 			ts_rank_cd(search_vector, websearch_to_tsquery('english', $2)) * $4
 		) DESC
 		LIMIT $5
 	`
 
-	// Build WHERE
-	conditions := []string{"1=1"}
-	if req.Scope == "mine" {
-		if req.UserID == "" {
-			return nil, fmt.Errorf("user_id required for scope=mine")
-		}
-		conditions = append(conditions, fmt.Sprintf("owner_user_id = '%s'", req.UserID))
-	} else if req.Scope == "public" {
-		conditions = append(conditions, "visibility = 'public'")
-	} else { // all
-		if req.UserID != "" {
-			conditions = append(conditions, fmt.Sprintf("(visibility = 'public' OR owner_user_id = '%s')", req.UserID))
-		} else {
-			conditions = append(conditions, "visibility = 'public'")
+	// Build WHERE. The 5 base args below ($1-$5) are fixed, so extra
+	// WHERE args continue the sequence from $6.
+	whereStr, whereArgs, err := buildVisibilityConditions(req, 5)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	finalQuery := fmt.Sprintf(simpleQuery, whereStr)
+	args := append([]any{pgvector.NewVector(req.Vector), req.TextQuery, vecWeight, hybridBoost, req.K}, whereArgs...)
+
+	rows, err := s.pool.Query(ctx, finalQuery, args...)
+	return rows, vecWeight, hybridBoost, err
+}
+
+// scanLinearRow decodes one row from queryLinear's result set into a
+// SearchResultItem, including the optional highlight column.
+func scanLinearRow(rows pgx.Rows, req models.SearchRequest, vecWeight, hybridBoost float32) (models.SearchResultItem, error) {
+	var item models.SearchResultItem
+	var vecScore, textScore float32
+	var headline *string
+	var queryLexemes, matchedLexemes int
+	scanArgs := []any{
+		&item.ID,
+		&vecScore,
+		&textScore,
+		&item.Caption,
+		&item.CaptionConfidence,
+		&item.CaptionOrigin,
+		&item.OwnerUserID,
+		&item.Visibility,
+		&item.CreatedAt,
+	}
+	if req.Highlight {
+		scanArgs = append(scanArgs, &headline, &queryLexemes, &matchedLexemes)
+	}
+	if err := rows.Scan(scanArgs...); err != nil {
+		return models.SearchResultItem{}, err
+	}
+	item.VecScore = vecScore
+	item.TextScore = textScore
+	item.Score = (vecScore * vecWeight) + (textScore * hybridBoost)
+	if req.Highlight && headline != nil {
+		item.Highlights = map[string]models.Highlight{
+			"caption": buildHighlight(*headline, queryLexemes, matchedLexemes),
 		}
 	}
+	return item, nil
+}
+
+// SearchStream is Search's incremental counterpart. For the linear scoring
+// path, Postgres has already produced the final ordering by the time rows
+// arrive, so each row is forwarded to the channel as soon as it's scanned
+// instead of being buffered into a slice first. RRF fusion can't start
+// until both the vector and text candidate lists are fully fetched (the
+// fused rank depends on a row's position in each), so that path still
+// computes the full result set before streaming it out.
+func (s *PostgresStore) SearchStream(ctx context.Context, req models.SearchRequest) (<-chan models.SearchResultItem, <-chan error) {
+	itemCh := make(chan models.SearchResultItem)
+	errCh := make(chan error, 1)
+
+	if req.FusionMode == "rrf" {
+		go func() {
+			defer close(itemCh)
+			defer close(errCh)
+			results, err := s.searchRRF(ctx, req)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			for _, item := range results {
+				select {
+				case itemCh <- item:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return itemCh, errCh
+	}
+
+	go func() {
+		defer close(itemCh)
+		defer close(errCh)
+
+		rows, vecWeight, hybridBoost, err := s.queryLinear(ctx, req)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			item, err := scanLinearRow(rows, req, vecWeight, hybridBoost)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			select {
+			case itemCh <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			errCh <- err
+		}
+	}()
+
+	return itemCh, errCh
+}
+
+// lexemeMatchColumns selects how many distinct stemmed lexemes the query
+// (bound at queryParam, e.g. "$2") contains, and how many of those also
+// appear in caption's tsvector. buildHighlight uses these counts (rather
+// than comparing the <mark>'d surface forms against raw query words)
+// because websearch_to_tsquery and ts_headline both match on stemmed
+// lexemes: a query for "bicycles" marks "bicycle" in the headline, and a
+// literal string comparison between those two would wrongly call that a
+// non-match.
+func lexemeMatchColumns(queryParam string) string {
+	return fmt.Sprintf(`
+			cardinality(tsvector_to_array(to_tsvector('english', %[1]s))) as query_lexemes,
+			(SELECT count(*) FROM (
+				SELECT unnest(tsvector_to_array(to_tsvector('english', caption)))
+				INTERSECT
+				SELECT unnest(tsvector_to_array(to_tsvector('english', %[1]s)))
+			) matched) as matched_lexemes`, queryParam)
+}
 
-	// Format vector as string for pgvector
-	var vecBuilder strings.Builder
-	vecBuilder.WriteString("[")
-	for i, v := range req.Vector {
-		if i > 0 {
-			vecBuilder.WriteString(",")
+// buildHighlight turns a ts_headline result into a models.Highlight. The
+// <mark>...</mark> spans give the surface-form MatchedWords shown to the
+// caller; matchLevel itself is derived from queryLexemes/matchedLexemes
+// (see lexemeMatchColumns), since the marked-up words can't be compared
+// against the raw query text directly once stemming is involved.
+func buildHighlight(headline string, queryLexemes, matchedLexemes int) models.Highlight {
+	var matchedWords []string
+	seen := map[string]bool{}
+	remaining := headline
+	for {
+		start := strings.Index(remaining, "<mark>")
+		if start == -1 {
+			break
+		}
+		remaining = remaining[start+len("<mark>"):]
+		end := strings.Index(remaining, "</mark>")
+		if end == -1 {
+			break
 		}
-		vecBuilder.WriteString(fmt.Sprintf("%f", v))
+		word := strings.ToLower(remaining[:end])
+		if !seen[word] {
+			seen[word] = true
+			matchedWords = append(matchedWords, word)
+		}
+		remaining = remaining[end+len("</mark>"):]
 	}
-	vecBuilder.WriteString("]")
-	vecStr := vecBuilder.String()
 
-	whereStr := strings.Join(conditions, " AND ")
-	finalQuery := fmt.Sprintf(simpleQuery, whereStr)
+	matchLevel := "none"
+	switch {
+	case queryLexemes == 0 || matchedLexemes == 0:
+		matchLevel = "none"
+	case matchedLexemes >= queryLexemes:
+		matchLevel = "full"
+	default:
+		matchLevel = "partial"
+	}
+
+	return models.Highlight{
+		Value:            headline,
+		MatchLevel:       matchLevel,
+		MatchedWords:     matchedWords,
+		FullyHighlighted: matchLevel == "full",
+	}
+}
 
-	rows, err := s.pool.Query(ctx, finalQuery, vecStr, req.TextQuery, vecWeight, hybridBoost, req.K)
+// rrfCandidate accumulates a row's presence across the vector and text
+// candidate lists so searchRRF can compute a fused rank-based score.
+type rrfCandidate struct {
+	item      models.SearchResultItem
+	vecScore  float32
+	textScore float32
+	vecRank   int // 0 means "not present in the vector list"
+	textRank  int // 0 means "not present in the text list"
+}
+
+// searchRRF implements the FusionMode="rrf" path: it ranks candidates by
+// vector similarity and by text relevance independently (avoiding the two
+// signals' incomparable raw scales), then fuses the two rankings with
+// Reciprocal Rank Fusion: score = sum(1 / (k_rrf + rank)) over the lists a
+// candidate appears in.
+func (s *PostgresStore) searchRRF(ctx context.Context, req models.SearchRequest) ([]models.SearchResultItem, error) {
+	k := req.K
+	if k <= 0 {
+		k = 10
+	}
+	rrfK := req.RRFK
+	if rrfK <= 0 {
+		rrfK = defaultRRFK
+	}
+	limit := k * 5
+	if limit < 100 {
+		limit = 100
+	}
+
+	// Each query below only has 2 base args ($1, $2), so WHERE args in both
+	// continue from $3; they're built separately since each is its own
+	// prepared statement.
+	vecWhereStr, vecWhereArgs, err := buildVisibilityConditions(req, 2)
+	if err != nil {
+		return nil, err
+	}
+	textWhereStr, textWhereArgs, err := buildVisibilityConditions(req, 2)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var results []models.SearchResultItem
-	for rows.Next() {
-		var item models.SearchResultItem
-		var vecScore, textScore float32
-		err := rows.Scan(
-			&item.ID,
-			&vecScore,
-			&textScore,
-			&item.Caption,
-			&item.CaptionConfidence,
-			&item.CaptionOrigin,
-			&item.OwnerUserID,
-			&item.Visibility,
-			&item.CreatedAt,
-		)
+	vecQuery := fmt.Sprintf(`
+		SELECT id, (1 - (embed_vector <=> $1)) as vec_score, caption, caption_confidence,
+			caption_origin, owner_user_id::text, visibility, created_at::text
+		FROM images
+		WHERE %s
+		ORDER BY embed_vector <=> $1 ASC
+		LIMIT $2
+	`, vecWhereStr)
+
+	textQuery := fmt.Sprintf(`
+		SELECT id, ts_rank_cd(search_vector, websearch_to_tsquery('english', $1)) as text_score, caption,
+			caption_confidence, caption_origin, owner_user_id::text, visibility, created_at::text
+		FROM images
+		WHERE %s
+		ORDER BY ts_rank_cd(search_vector, websearch_to_tsquery('english', $1)) DESC
+		LIMIT $2
+	`, textWhereStr)
+
+	type queryResult struct {
+		rows []rrfCandidate
+		err  error
+	}
+	vecCh := make(chan queryResult, 1)
+	textCh := make(chan queryResult, 1)
+
+	go func() {
+		args := append([]any{pgvector.NewVector(req.Vector), limit}, vecWhereArgs...)
+		rows, err := s.pool.Query(ctx, vecQuery, args...)
 		if err != nil {
-			return nil, err
+			vecCh <- queryResult{err: err}
+			return
+		}
+		defer rows.Close()
+		var out []rrfCandidate
+		for rows.Next() {
+			var c rrfCandidate
+			if err := rows.Scan(&c.item.ID, &c.vecScore, &c.item.Caption, &c.item.CaptionConfidence,
+				&c.item.CaptionOrigin, &c.item.OwnerUserID, &c.item.Visibility, &c.item.CreatedAt); err != nil {
+				vecCh <- queryResult{err: err}
+				return
+			}
+			out = append(out, c)
+		}
+		vecCh <- queryResult{rows: out, err: rows.Err()}
+	}()
+
+	go func() {
+		args := append([]any{req.TextQuery, limit}, textWhereArgs...)
+		rows, err := s.pool.Query(ctx, textQuery, args...)
+		if err != nil {
+			textCh <- queryResult{err: err}
+			return
 		}
-		item.VecScore = vecScore
-		item.TextScore = textScore
-		item.Score = (vecScore * float32(vecWeight)) + (textScore * float32(hybridBoost))
+		defer rows.Close()
+		var out []rrfCandidate
+		for rows.Next() {
+			var c rrfCandidate
+			if err := rows.Scan(&c.item.ID, &c.textScore, &c.item.Caption, &c.item.CaptionConfidence,
+				&c.item.CaptionOrigin, &c.item.OwnerUserID, &c.item.Visibility, &c.item.CreatedAt); err != nil {
+				textCh <- queryResult{err: err}
+				return
+			}
+			out = append(out, c)
+		}
+		textCh <- queryResult{rows: out, err: rows.Err()}
+	}()
+
+	vecResult, textResult := <-vecCh, <-textCh
+	if vecResult.err != nil {
+		return nil, vecResult.err
+	}
+	if textResult.err != nil {
+		return nil, textResult.err
+	}
+
+	merged := make(map[string]*rrfCandidate, len(vecResult.rows)+len(textResult.rows))
+	for i, c := range vecResult.rows {
+		c := c
+		c.vecRank = i + 1
+		merged[c.item.ID] = &c
+	}
+	for i, c := range textResult.rows {
+		rank := i + 1
+		if existing, ok := merged[c.item.ID]; ok {
+			existing.textScore = c.textScore
+			existing.textRank = rank
+			continue
+		}
+		c := c
+		c.textRank = rank
+		merged[c.item.ID] = &c
+	}
+
+	candidates := make([]*rrfCandidate, 0, len(merged))
+	for _, c := range merged {
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return rrfScore(candidates[i], rrfK) > rrfScore(candidates[j], rrfK)
+	})
+
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+
+	results := make([]models.SearchResultItem, 0, len(candidates))
+	for _, c := range candidates {
+		item := c.item
+		item.VecScore = c.vecScore
+		item.TextScore = c.textScore
+		item.Score = rrfScore(c, rrfK)
 		results = append(results, item)
 	}
+
+	if req.Highlight && len(results) > 0 {
+		if err := s.attachHighlights(ctx, results, req.TextQuery); err != nil {
+			return nil, err
+		}
+	}
+
 	return results, nil
 }
+
+// attachHighlights populates Highlights on each of results in place. It's
+// called after RRF has already picked the final top-K, rather than
+// threading a ts_headline column through the vector/text candidate
+// queries, since computing headlines for the much larger candidate window
+// (N=max(k*5, 100) per list) would be wasted work for every row fusion
+// ultimately discards.
+func (s *PostgresStore) attachHighlights(ctx context.Context, results []models.SearchResultItem, textQuery string) error {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, ts_headline('english', caption, websearch_to_tsquery('english', $1),
+			'StartSel=<mark>,StopSel=</mark>,MaxWords=35,MinWords=15') as headline,
+		`+lexemeMatchColumns("$1")+`
+		FROM images
+		WHERE id = ANY($2)
+	`, textQuery, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type headlineMatch struct {
+		headline                     string
+		queryLexemes, matchedLexemes int
+	}
+	headlines := make(map[string]headlineMatch, len(ids))
+	for rows.Next() {
+		var id string
+		var m headlineMatch
+		if err := rows.Scan(&id, &m.headline, &m.queryLexemes, &m.matchedLexemes); err != nil {
+			return err
+		}
+		headlines[id] = m
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range results {
+		m, ok := headlines[results[i].ID]
+		if !ok {
+			continue
+		}
+		results[i].Highlights = map[string]models.Highlight{
+			"caption": buildHighlight(m.headline, m.queryLexemes, m.matchedLexemes),
+		}
+	}
+	return nil
+}
+
+func rrfScore(c *rrfCandidate, rrfK int) float32 {
+	var score float32
+	if c.vecRank > 0 {
+		score += 1.0 / float32(rrfK+c.vecRank)
+	}
+	if c.textRank > 0 {
+		score += 1.0 / float32(rrfK+c.textRank)
+	}
+	return score
+}
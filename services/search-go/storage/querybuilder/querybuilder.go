@@ -0,0 +1,53 @@
+// Package querybuilder assembles SQL WHERE clauses from bound parameters
+// instead of string-interpolated values, so user-controlled fields like
+// SearchRequest.UserID can never be concatenated directly into a query.
+package querybuilder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Builder accumulates WHERE conditions and their arguments. Placeholders
+// are numbered starting after the base query's own positional args, so a
+// Builder for a query whose base args are $1..$5 is constructed with
+// New(5) and will emit $6, $7, ...
+type Builder struct {
+	nextArg    int
+	conditions []string
+	args       []any
+}
+
+// New returns a Builder whose first emitted placeholder is $startAt+1.
+func New(startAt int) *Builder {
+	return &Builder{nextArg: startAt}
+}
+
+// And adds a condition built from template, where each %s is replaced by
+// the next numbered placeholder in order; the corresponding values are
+// appended to the bound argument list.
+func (b *Builder) And(template string, values ...any) *Builder {
+	placeholders := make([]any, len(values))
+	for i, v := range values {
+		b.nextArg++
+		placeholders[i] = fmt.Sprintf("$%d", b.nextArg)
+		b.args = append(b.args, v)
+	}
+	b.conditions = append(b.conditions, fmt.Sprintf(template, placeholders...))
+	return b
+}
+
+// Raw adds a condition that takes no bound values (e.g. a static literal).
+func (b *Builder) Raw(condition string) *Builder {
+	b.conditions = append(b.conditions, condition)
+	return b
+}
+
+// Build returns the joined WHERE clause and the accumulated arguments, to
+// be appended after the base query's own args in the same order.
+func (b *Builder) Build() (string, []any) {
+	if len(b.conditions) == 0 {
+		return "1=1", nil
+	}
+	return strings.Join(b.conditions, " AND "), b.args
+}
@@ -0,0 +1,76 @@
+package querybuilder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuilder_NoConditions(t *testing.T) {
+	where, args := New(5).Build()
+	if where != "1=1" {
+		t.Errorf("where = %q, want %q", where, "1=1")
+	}
+	if args != nil {
+		t.Errorf("args = %v, want nil", args)
+	}
+}
+
+func TestBuilder_RawOnly(t *testing.T) {
+	where, args := New(0).Raw("visibility = 'public'").Build()
+	if where != "visibility = 'public'" {
+		t.Errorf("where = %q, want %q", where, "visibility = 'public'")
+	}
+	if args != nil {
+		t.Errorf("args = %v, want nil", args)
+	}
+}
+
+func TestBuilder_AndContinuesPlaceholderSequence(t *testing.T) {
+	// startAt=5 mimics a base query that already uses $1..$5.
+	where, args := New(5).And("owner_user_id = %s", "user-1").Build()
+	if where != "owner_user_id = $6" {
+		t.Errorf("where = %q, want %q", where, "owner_user_id = $6")
+	}
+	if !reflect.DeepEqual(args, []any{"user-1"}) {
+		t.Errorf("args = %v, want [user-1]", args)
+	}
+}
+
+func TestBuilder_MultipleConditionsNumberSequentially(t *testing.T) {
+	where, args := New(2).
+		And("owner_user_id = %s", "user-1").
+		And("(visibility = 'public' OR owner_user_id = %s)", "user-2").
+		Build()
+
+	want := "owner_user_id = $3 AND (visibility = 'public' OR owner_user_id = $4)"
+	if where != want {
+		t.Errorf("where = %q, want %q", where, want)
+	}
+	if !reflect.DeepEqual(args, []any{"user-1", "user-2"}) {
+		t.Errorf("args = %v, want [user-1 user-2]", args)
+	}
+}
+
+func TestBuilder_AndWithMultipleValuesInOneTemplate(t *testing.T) {
+	where, args := New(0).And("owner_user_id = %s AND scope = %s", "user-1", "mine").Build()
+	if where != "owner_user_id = $1 AND scope = $2" {
+		t.Errorf("where = %q, want %q", where, "owner_user_id = $1 AND scope = $2")
+	}
+	if !reflect.DeepEqual(args, []any{"user-1", "mine"}) {
+		t.Errorf("args = %v, want [user-1 mine]", args)
+	}
+}
+
+// TestBuilder_NeverInterpolatesValuesIntoSQL is the actual regression test
+// for the bug this package fixes: a value containing SQL syntax must only
+// ever appear in the bound args, never spliced into the WHERE text itself.
+func TestBuilder_NeverInterpolatesValuesIntoSQL(t *testing.T) {
+	malicious := "' OR '1'='1"
+	where, args := New(0).And("owner_user_id = %s", malicious).Build()
+	if where != "owner_user_id = $1" {
+		t.Errorf("where = %q, want %q", where, "owner_user_id = $1")
+	}
+	if len(args) != 1 || args[0] != malicious {
+		t.Errorf("args = %v, want [%q]", args, malicious)
+	}
+}